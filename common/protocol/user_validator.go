@@ -0,0 +1,24 @@
+package protocol
+
+// UserValidator is the interface to verify and manage a set of users in an
+// inbound handler. Implementations are expected to be safe for concurrent
+// use.
+type UserValidator interface {
+	// Add a user into user validator.
+	Add(user *User) error
+
+	// Get a user from a hash key, rejecting and returning false if the hash
+	// is unknown or otherwise invalid (for example, a replayed handshake).
+	Get(userHash []byte) (*User, Timestamp, bool)
+
+	// Remove deletes the user identified by email from the validator. It
+	// returns false if no such user exists. This lets an inbound handler
+	// revoke a user's credentials at runtime without restarting.
+	Remove(email string) bool
+
+	// Replace atomically swaps the validator's entire user set for users,
+	// so a caller observes either the old set or the new set, never a
+	// partial mix. This powers hot-reloading large user sets from an
+	// external source without restarting the inbound handler.
+	Replace(users []*User) error
+}
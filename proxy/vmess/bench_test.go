@@ -0,0 +1,128 @@
+package vmess
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"v2ray.com/core/common/protocol"
+	"v2ray.com/core/common/serial"
+)
+
+// legacyHashCache is a minimal reconstruction of the pre-ring-buffer design:
+// a single global map keyed by the full 16-byte hash, populated up front for
+// every idEntry's window. It exists only so BenchmarkGet can compare it
+// against the current per-idEntry ring buffer design at varying user counts.
+type legacyHashCache struct {
+	hasher   protocol.IDHash
+	userHash map[[16]byte]int
+}
+
+func newLegacyHashCache(hasher protocol.IDHash, users []*protocol.User) *legacyHashCache {
+	c := &legacyHashCache{
+		hasher:   hasher,
+		userHash: make(map[[16]byte]int, len(users)*hashRingSize),
+	}
+	nowSec := time.Now().Unix()
+	for idx, user := range users {
+		account := mustInternalAccount(user)
+		c.populate(idx, account.ID, nowSec)
+		for _, alterid := range account.AlterIDs {
+			c.populate(idx, alterid, nowSec)
+		}
+	}
+	return c
+}
+
+func (c *legacyHashCache) populate(idx int, id *protocol.ID, nowSec int64) {
+	idHash := c.hasher(id.Bytes())
+	var hashValue [16]byte
+	for t := protocol.Timestamp(nowSec - cacheDurationSec); t <= protocol.Timestamp(nowSec+cacheDurationSec); t++ {
+		idHash.Write(t.Bytes(nil))
+		idHash.Sum(hashValue[:0])
+		idHash.Reset()
+		c.userHash[hashValue] = idx
+	}
+}
+
+func (c *legacyHashCache) Get(hash []byte) (int, bool) {
+	var fixedSizeHash [16]byte
+	copy(fixedSizeHash[:], hash)
+	idx, found := c.userHash[fixedSizeHash]
+	return idx, found
+}
+
+func mustInternalAccount(user *protocol.User) *InternalAccount {
+	raw, err := user.GetTypedAccount()
+	if err != nil {
+		panic(err)
+	}
+	return raw.(*InternalAccount)
+}
+
+func benchUsers(n int) []*protocol.User {
+	users := make([]*protocol.User, n)
+	for i := 0; i < n; i++ {
+		users[i] = &protocol.User{
+			Email: fmt.Sprintf("bench%d@example.com", i),
+			Account: serial.ToTypedMessage(&Account{
+				Id: fmt.Sprintf("b831381d-6324-4d53-ad4f-%012d", i),
+			}),
+		}
+	}
+	return users
+}
+
+var benchUserCounts = []int{1, 100, 10000}
+
+// BenchmarkGetRingBuffer measures Get on the current per-idEntry ring
+// buffer + shortlist design.
+func BenchmarkGetRingBuffer(b *testing.B) {
+	for _, n := range benchUserCounts {
+		b.Run(fmt.Sprintf("users=%d", n), func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			v := NewTimedUserValidator(ctx, testHasher, DisableReplayFilter()).(*TimedUserValidator)
+			for _, user := range benchUsers(n) {
+				if err := v.Add(user); err != nil {
+					b.Fatal(err)
+				}
+			}
+			hashBytes := latestHash(v.ids[0])
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, ok := v.Get(hashBytes); !ok {
+					b.Fatal("expected Get to find the hash")
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkGetLegacyMap measures Get on the design it replaced: a single
+// global map[[16]byte]int populated for every idEntry's window up front.
+func BenchmarkGetLegacyMap(b *testing.B) {
+	for _, n := range benchUserCounts {
+		b.Run(fmt.Sprintf("users=%d", n), func(b *testing.B) {
+			users := benchUsers(n)
+			cache := newLegacyHashCache(testHasher, users)
+
+			var hashBytes []byte
+			for key := range cache.userHash {
+				fixedSizeHash := key
+				hashBytes = fixedSizeHash[:]
+				break
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, ok := cache.Get(hashBytes); !ok {
+					b.Fatal("expected Get to find the hash")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package vmess
+
+import (
+	"context"
+
+	"v2ray.com/core/common/protocol"
+)
+
+// UserSource provides a dynamic set of VMess users to an inbound handler.
+// It lets operators manage large or frequently changing user bases without
+// restarting v2ray, complementing the one-shot Add/Remove calls on
+// TimedUserValidator.
+type UserSource interface {
+	// Load returns the full current set of users known to the source.
+	Load(ctx context.Context) ([]*protocol.User, error)
+
+	// Watch returns a channel that emits the full user set every time it
+	// changes. The channel is closed once the source can no longer watch
+	// for changes, including when ctx is done.
+	Watch(ctx context.Context) (<-chan []*protocol.User, error)
+}
+
+// SyncUsers loads the current user set from src and applies it to v via
+// Replace, then keeps v in sync with every update src emits on Watch. It
+// blocks until ctx is done or src stops watching.
+func SyncUsers(ctx context.Context, src UserSource, v *TimedUserValidator) error {
+	users, err := src.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if err := v.Replace(users); err != nil {
+		return err
+	}
+
+	updates, err := src.Watch(ctx)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case users, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			if err := v.Replace(users); err != nil {
+				newError("failed to apply updated user set").Base(err).WriteToLog()
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
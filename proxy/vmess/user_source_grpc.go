@@ -0,0 +1,89 @@
+package vmess
+
+import (
+	"context"
+
+	"v2ray.com/core/common/protocol"
+	"v2ray.com/core/common/serial"
+)
+
+// UserStreamEntry mirrors FileUserEntry as the element type of a
+// GRPCUserSource stream, so file-based and gRPC-based sources share the same
+// wire representation of a user.
+type UserStreamEntry = FileUserEntry
+
+// UserStreamClient is the subset of a generated gRPC client that
+// GRPCUserSource needs. No generated client or .proto definition is included
+// here; callers supply their own implementation.
+type UserStreamClient interface {
+	// ListUsers returns the full user set at the current moment.
+	ListUsers(ctx context.Context) ([]UserStreamEntry, error)
+
+	// StreamUsers returns a channel of full user set snapshots, one per
+	// server-pushed update. The channel is closed when the stream ends.
+	StreamUsers(ctx context.Context) (<-chan []UserStreamEntry, error)
+}
+
+// GRPCUserSource is a UserSource backed by a gRPC streaming client, for
+// operators who push user set updates from a central control plane rather
+// than polling a file or HTTP endpoint.
+type GRPCUserSource struct {
+	Client UserStreamClient
+}
+
+// NewGRPCUserSource returns a UserSource that delegates to client.
+func NewGRPCUserSource(client UserStreamClient) *GRPCUserSource {
+	return &GRPCUserSource{Client: client}
+}
+
+func (s *GRPCUserSource) Load(ctx context.Context) ([]*protocol.User, error) {
+	entries, err := s.Client.ListUsers(ctx)
+	if err != nil {
+		return nil, newError("failed to list users from gRPC user source").Base(err)
+	}
+	return toProtocolUsers(entries), nil
+}
+
+func (s *GRPCUserSource) Watch(ctx context.Context) (<-chan []*protocol.User, error) {
+	updates, err := s.Client.StreamUsers(ctx)
+	if err != nil {
+		return nil, newError("failed to open gRPC user source stream").Base(err)
+	}
+
+	out := make(chan []*protocol.User)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case entries, ok := <-updates:
+				if !ok {
+					return
+				}
+				select {
+				case out <- toProtocolUsers(entries):
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func toProtocolUsers(entries []UserStreamEntry) []*protocol.User {
+	users := make([]*protocol.User, 0, len(entries))
+	for _, entry := range entries {
+		users = append(users, &protocol.User{
+			Level: entry.Level,
+			Email: entry.Email,
+			Account: serial.ToTypedMessage(&Account{
+				Id:      entry.ID,
+				AlterId: entry.AlterID,
+			}),
+		})
+	}
+	return users
+}
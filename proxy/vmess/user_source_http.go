@@ -0,0 +1,128 @@
+package vmess
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"v2ray.com/core/common/protocol"
+)
+
+const defaultHTTPUserSourcePollInterval = 30 * time.Second
+
+// HTTPUserSource is a UserSource backed by an HTTP(S) endpoint that serves a
+// JSON array of FileUserEntry records. It polls the endpoint on Interval and
+// uses the response's ETag to avoid re-parsing a body that has not changed.
+type HTTPUserSource struct {
+	URL      string
+	Client   *http.Client
+	Interval time.Duration
+
+	etagMu   sync.Mutex
+	lastETag string
+}
+
+// NewHTTPUserSource returns a UserSource that polls url for updated user
+// sets. If interval is zero, defaultHTTPUserSourcePollInterval is used.
+func NewHTTPUserSource(url string, interval time.Duration) *HTTPUserSource {
+	if interval <= 0 {
+		interval = defaultHTTPUserSourcePollInterval
+	}
+	return &HTTPUserSource{
+		URL:      url,
+		Client:   http.DefaultClient,
+		Interval: interval,
+	}
+}
+
+// fetch retrieves the user source body. When conditional is true and a
+// previous fetch recorded an ETag, the request is made with If-None-Match so
+// an unchanged body short-circuits to a 304; Watch's poller uses this to
+// avoid re-parsing unchanged data. Load always fetches unconditionally, since
+// it promises the caller the full current set of users, not "nothing, because
+// it matches what a concurrently running Watch last saw".
+func (s *HTTPUserSource) fetch(ctx context.Context, conditional bool) ([]*protocol.User, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, false, newError("failed to create user source request").Base(err)
+	}
+	req = req.WithContext(ctx)
+
+	if conditional {
+		s.etagMu.Lock()
+		etag := s.lastETag
+		s.etagMu.Unlock()
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, false, newError("failed to fetch user source: ", s.URL).Base(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, newError("unexpected status from user source: ", resp.StatusCode)
+	}
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, newError("failed to read user source response").Base(err)
+	}
+
+	users, err := parseFileUsers(raw)
+	if err != nil {
+		return nil, false, err
+	}
+
+	s.etagMu.Lock()
+	s.lastETag = resp.Header.Get("ETag")
+	s.etagMu.Unlock()
+
+	return users, true, nil
+}
+
+func (s *HTTPUserSource) Load(ctx context.Context) ([]*protocol.User, error) {
+	users, _, err := s.fetch(ctx, false)
+	return users, err
+}
+
+func (s *HTTPUserSource) Watch(ctx context.Context) (<-chan []*protocol.User, error) {
+	out := make(chan []*protocol.User)
+	go func() {
+		defer close(out)
+
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				users, changed, err := s.fetch(ctx, true)
+				if err != nil {
+					newError("failed to poll user source: ", s.URL).Base(err).WriteToLog()
+					continue
+				}
+				if !changed {
+					continue
+				}
+				select {
+				case out <- users:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
@@ -0,0 +1,87 @@
+package vmess
+
+import (
+	"testing"
+
+	"v2ray.com/core/common/protocol"
+)
+
+func TestReplaceSwapsUserSet(t *testing.T) {
+	v, cancel := newTestValidator()
+	defer cancel()
+
+	userA := newTestUser("a@example.com", "b831381d-6324-4d53-ad4f-8cda48b30840")
+	if err := v.Add(userA); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	hashA := append([]byte(nil), latestHash(v.ids[0])...)
+
+	userB := newTestUser("b@example.com", "b831381d-6324-4d53-ad4f-8cda48b30841")
+	if err := v.Replace([]*protocol.User{userB}); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+
+	if _, _, ok := v.Get(hashA); ok {
+		t.Fatalf("expected user A's hash to stop authenticating after Replace")
+	}
+	if _, found := v.userByEmail["a@example.com"]; found {
+		t.Fatalf("expected userByEmail to no longer contain the replaced-out user")
+	}
+
+	hashB := latestHash(v.ids[0])
+	gotB, _, ok := v.Get(hashB)
+	if !ok || gotB != userB {
+		t.Fatalf("expected user B to authenticate after Replace")
+	}
+}
+
+func TestParseFileUsersJSON(t *testing.T) {
+	raw := []byte(`[{"id":"b831381d-6324-4d53-ad4f-8cda48b30850","alterId":4,"email":"[email protected]","level":1}]`)
+
+	users, err := parseFileUsers(raw)
+	if err != nil {
+		t.Fatalf("parseFileUsers: %v", err)
+	}
+	if len(users) != 1 {
+		t.Fatalf("expected 1 user, got %d", len(users))
+	}
+	if users[0].Email != "[email protected]" {
+		t.Fatalf("unexpected email: %s", users[0].Email)
+	}
+	if _, err := users[0].GetTypedAccount(); err != nil {
+		t.Fatalf("GetTypedAccount: %v", err)
+	}
+}
+
+func TestParseYAMLUsers(t *testing.T) {
+	raw := []byte("- id: b831381d-6324-4d53-ad4f-8cda48b30851\n  alterId: 4\n  email: [email protected]\n  level: 1\n")
+
+	users, err := parseYAMLUsers(raw)
+	if err != nil {
+		t.Fatalf("parseYAMLUsers: %v", err)
+	}
+	if len(users) != 1 {
+		t.Fatalf("expected 1 user, got %d", len(users))
+	}
+	if users[0].Email != "[email protected]" {
+		t.Fatalf("unexpected email: %s", users[0].Email)
+	}
+	if _, err := users[0].GetTypedAccount(); err != nil {
+		t.Fatalf("GetTypedAccount: %v", err)
+	}
+}
+
+func TestIsYAMLPath(t *testing.T) {
+	cases := map[string]bool{
+		"users.yaml": true,
+		"users.yml":  true,
+		"users.YAML": true,
+		"users.json": false,
+		"users":      false,
+	}
+	for path, want := range cases {
+		if got := isYAMLPath(path); got != want {
+			t.Errorf("isYAMLPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -9,6 +9,7 @@ package vmess
 
 import (
 	"context"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,63 +20,166 @@ import (
 const (
 	updateIntervalSec = 10
 	cacheDurationSec  = 120
+
+	// hashRingSize bounds the number of hashes retained per idEntry to the
+	// same ~240 entries (2 * cacheDurationSec) the old global map held per
+	// ID, but as a fixed-size ring rather than an ever-growing map, so a
+	// write never needs a separate sweep to reclaim the slot it overwrites.
+	// generateNewHashes fills lastSec from nowSec-cacheDurationSec through
+	// nowSec+cacheDurationSec inclusive, i.e. 2*cacheDurationSec+1 writes, so
+	// the ring needs room for all of them or the very first write evicts the
+	// oldest still-in-window hash before Add/Replace even returns.
+	hashRingSize = cacheDurationSec*2 + 1
 )
 
+// hashRingSlot is one generated authentication hash, along with the time
+// offset it was generated for. valid is false both for a slot that has never
+// been written (zero value) and for one that has been evicted.
+type hashRingSlot struct {
+	full    [16]byte
+	timeInc uint32
+	valid   bool
+}
+
 type idEntry struct {
 	id      *protocol.ID
 	userIdx int
 	lastSec protocol.Timestamp
+	expired bool
+
+	ring     [hashRingSize]hashRingSlot
+	ringHead int
+}
+
+// hashCandidate is a shortlisted match for a hash's first 8 bytes: the
+// idEntry (by index into TimedUserValidator.ids) and the ring slot that may
+// hold the full 16-byte hash.
+type hashCandidate struct {
+	entryIdx int
+	ringPos  int
 }
 
 type TimedUserValidator struct {
 	sync.RWMutex
-	validUsers []*protocol.User
-	userHash   map[[16]byte]indexTimePair
-	ids        []*idEntry
-	hasher     protocol.IDHash
-	baseTime   protocol.Timestamp
+	validUsers  []*protocol.User
+	shortlist   map[[8]byte][]hashCandidate
+	ids         []*idEntry
+	userByEmail map[string]int
+	hasher      protocol.IDHash
+	baseTime    protocol.Timestamp
+
+	// usedHash records hashes already consumed by Get, for replay rejection.
+	// It is a sync.Map rather than a plain map guarded by the RWMutex above
+	// so that concurrent Get calls - the hot path for every VMess
+	// authentication - only need a read lock on the validator itself and
+	// aren't serialized behind replay bookkeeping.
+	usedHash      *sync.Map
+	disableReplay bool
 }
 
-type indexTimePair struct {
-	index   int
-	timeInc uint32
+// Option configures optional behavior of a TimedUserValidator created by
+// NewTimedUserValidator.
+type Option func(*TimedUserValidator)
+
+// DisableReplayFilter turns off replay detection on the validator. Only use
+// this for deployments where clients are known to legitimately resend the
+// same authentication hash, since it reopens the replay window that the
+// filter otherwise closes.
+func DisableReplayFilter() Option {
+	return func(v *TimedUserValidator) {
+		v.disableReplay = true
+	}
 }
 
-func NewTimedUserValidator(ctx context.Context, hasher protocol.IDHash) protocol.UserValidator {
+func NewTimedUserValidator(ctx context.Context, hasher protocol.IDHash, options ...Option) protocol.UserValidator {
 	tus := &TimedUserValidator{
-		validUsers: make([]*protocol.User, 0, 16),
-		userHash:   make(map[[16]byte]indexTimePair, 512),
-		ids:        make([]*idEntry, 0, 512),
-		hasher:     hasher,
-		baseTime:   protocol.Timestamp(time.Now().Unix() - cacheDurationSec*3),
+		validUsers:  make([]*protocol.User, 0, 16),
+		shortlist:   make(map[[8]byte][]hashCandidate, 512),
+		usedHash:    new(sync.Map),
+		ids:         make([]*idEntry, 0, 512),
+		userByEmail: make(map[string]int, 16),
+		hasher:      hasher,
+		baseTime:    protocol.Timestamp(time.Now().Unix() - cacheDurationSec*3),
+	}
+	for _, option := range options {
+		option(tus)
 	}
 	go tus.updateUserHash(ctx, updateIntervalSec*time.Second)
 	return tus
 }
 
-func (v *TimedUserValidator) generateNewHashes(nowSec protocol.Timestamp, idx int, entry *idEntry) {
-	var hashValue [16]byte
+// shortKeyOf returns the two-level lookup key for a full hash: its first 8
+// bytes. Collisions on this prefix are resolved by verifying the full hash
+// stored in the shortlisted ring slot.
+func shortKeyOf(full [16]byte) [8]byte {
+	var key [8]byte
+	copy(key[:], full[:8])
+	return key
+}
+
+// evictRingSlot removes the shortlist entry for entry's ring slot at pos, if
+// any, and marks the slot empty. This is what makes both hash generation
+// (overwriting the oldest slot) and Remove (tombstoning a user) O(1) per
+// slot instead of requiring a scan over every cached hash.
+func (v *TimedUserValidator) evictRingSlot(entryIdx, pos int) {
+	entry := v.ids[entryIdx]
+	slot := &entry.ring[pos]
+	if !slot.valid {
+		return
+	}
+
+	key := shortKeyOf(slot.full)
+	candidates := v.shortlist[key]
+	for i, c := range candidates {
+		if c.entryIdx == entryIdx && c.ringPos == pos {
+			candidates[i] = candidates[len(candidates)-1]
+			candidates = candidates[:len(candidates)-1]
+			break
+		}
+	}
+	if len(candidates) == 0 {
+		delete(v.shortlist, key)
+	} else {
+		v.shortlist[key] = candidates
+	}
+
+	slot.valid = false
+}
+
+func (v *TimedUserValidator) generateNewHashes(nowSec protocol.Timestamp, entryIdx int, entry *idEntry) {
+	if entry.expired {
+		return
+	}
 	idHash := v.hasher(entry.id.Bytes())
 	for entry.lastSec <= nowSec {
+		var hashValue [16]byte
 		common.Must2(idHash.Write(entry.lastSec.Bytes(nil)))
 		idHash.Sum(hashValue[:0])
 		idHash.Reset()
 
-		v.userHash[hashValue] = indexTimePair{
-			index:   idx,
+		pos := entry.ringHead
+		v.evictRingSlot(entryIdx, pos)
+		entry.ring[pos] = hashRingSlot{
+			full:    hashValue,
 			timeInc: uint32(entry.lastSec - v.baseTime),
+			valid:   true,
 		}
+		entry.ringHead = (pos + 1) % hashRingSize
+
+		key := shortKeyOf(hashValue)
+		v.shortlist[key] = append(v.shortlist[key], hashCandidate{entryIdx: entryIdx, ringPos: pos})
 
 		entry.lastSec++
 	}
 }
 
-func (v *TimedUserValidator) removeExpiredHashes(expire uint32) {
-	for key, pair := range v.userHash {
-		if pair.timeInc < expire {
-			delete(v.userHash, key)
+func (v *TimedUserValidator) removeExpiredUsedHashes(expire uint32) {
+	v.usedHash.Range(func(key, value interface{}) bool {
+		if value.(uint32) < expire {
+			v.usedHash.Delete(key)
 		}
-	}
+		return true
+	})
 }
 
 func (v *TimedUserValidator) updateUserHash(ctx context.Context, interval time.Duration) {
@@ -84,13 +188,13 @@ func (v *TimedUserValidator) updateUserHash(ctx context.Context, interval time.D
 		case now := <-time.After(interval):
 			nowSec := protocol.Timestamp(now.Unix() + cacheDurationSec)
 			v.Lock()
-			for _, entry := range v.ids {
-				v.generateNewHashes(nowSec, entry.userIdx, entry)
+			for idx, entry := range v.ids {
+				v.generateNewHashes(nowSec, idx, entry)
 			}
 
 			expire := protocol.Timestamp(now.Unix() - cacheDurationSec*3)
 			if expire > v.baseTime {
-				v.removeExpiredHashes(uint32(expire - v.baseTime))
+				v.removeExpiredUsedHashes(uint32(expire - v.baseTime))
 			}
 			v.Unlock()
 		case <-ctx.Done():
@@ -99,12 +203,24 @@ func (v *TimedUserValidator) updateUserHash(ctx context.Context, interval time.D
 	}
 }
 
+func (v *TimedUserValidator) addIDEntry(id *protocol.ID, userIdx int, nowSec int64) {
+	entry := &idEntry{
+		id:      id,
+		userIdx: userIdx,
+		lastSec: protocol.Timestamp(nowSec - cacheDurationSec),
+	}
+	entryIdx := len(v.ids)
+	v.ids = append(v.ids, entry)
+	v.generateNewHashes(protocol.Timestamp(nowSec+cacheDurationSec), entryIdx, entry)
+}
+
 func (v *TimedUserValidator) Add(user *protocol.User) error {
 	v.Lock()
 	defer v.Unlock()
 
 	idx := len(v.validUsers)
 	v.validUsers = append(v.validUsers, user)
+	v.userByEmail[strings.ToLower(user.Email)] = idx
 	rawAccount, err := user.GetTypedAccount()
 	if err != nil {
 		return err
@@ -113,35 +229,187 @@ func (v *TimedUserValidator) Add(user *protocol.User) error {
 
 	nowSec := time.Now().Unix()
 
-	entry := &idEntry{
-		id:      account.ID,
-		userIdx: idx,
-		lastSec: protocol.Timestamp(nowSec - cacheDurationSec),
-	}
-	v.generateNewHashes(protocol.Timestamp(nowSec+cacheDurationSec), idx, entry)
-	v.ids = append(v.ids, entry)
+	v.addIDEntry(account.ID, idx, nowSec)
 	for _, alterid := range account.AlterIDs {
-		entry := &idEntry{
-			id:      alterid,
+		v.addIDEntry(alterid, idx, nowSec)
+	}
+
+	return nil
+}
+
+// Remove deletes the user identified by email from the validator. It returns
+// false if no such user exists. All idEntry records (primary ID and
+// alterIDs) belonging to the user are tombstoned so generateNewHashes stops
+// extending their rolling window, and every ring slot they have already
+// populated is evicted immediately so a revoked user cannot keep
+// authenticating against a still-cached hash. The tombstoned entries and the
+// nil validUsers slot are then compacted away so a revoke/reissue cycle does
+// not grow v.ids and v.validUsers without bound.
+func (v *TimedUserValidator) Remove(email string) bool {
+	v.Lock()
+	defer v.Unlock()
+
+	email = strings.ToLower(email)
+	idx, found := v.userByEmail[email]
+	if !found {
+		return false
+	}
+
+	v.validUsers[idx] = nil
+
+	for entryIdx, entry := range v.ids {
+		if entry.userIdx != idx {
+			continue
+		}
+		entry.expired = true
+		for pos := range entry.ring {
+			v.evictRingSlot(entryIdx, pos)
+		}
+	}
+
+	v.compact()
+
+	return true
+}
+
+// compact drops tombstoned idEntry records and nil validUsers slots left
+// behind by Remove, rewriting every userIdx/entryIdx reference (including
+// the shortlist's) so the validator's footprint reflects only the users
+// that are still active. Must be called with the write lock held.
+func (v *TimedUserValidator) compact() {
+	oldToNewUserIdx := make(map[int]int, len(v.validUsers))
+	newValidUsers := make([]*protocol.User, 0, len(v.validUsers))
+	for oldIdx, user := range v.validUsers {
+		if user == nil {
+			continue
+		}
+		oldToNewUserIdx[oldIdx] = len(newValidUsers)
+		newValidUsers = append(newValidUsers, user)
+	}
+
+	oldToNewEntryIdx := make(map[int]int, len(v.ids))
+	newIds := make([]*idEntry, 0, len(v.ids))
+	for oldIdx, entry := range v.ids {
+		if entry.expired {
+			continue
+		}
+		entry.userIdx = oldToNewUserIdx[entry.userIdx]
+		oldToNewEntryIdx[oldIdx] = len(newIds)
+		newIds = append(newIds, entry)
+	}
+
+	newShortlist := make(map[[8]byte][]hashCandidate, len(v.shortlist))
+	for key, candidates := range v.shortlist {
+		remapped := make([]hashCandidate, 0, len(candidates))
+		for _, c := range candidates {
+			newEntryIdx, ok := oldToNewEntryIdx[c.entryIdx]
+			if !ok {
+				// Its backing entry was tombstoned and evicted above; the
+				// shortlist should already be free of it, but skip rather
+				// than remap onto the wrong entry if it somehow isn't.
+				continue
+			}
+			remapped = append(remapped, hashCandidate{entryIdx: newEntryIdx, ringPos: c.ringPos})
+		}
+		if len(remapped) > 0 {
+			newShortlist[key] = remapped
+		}
+	}
+
+	newUserByEmail := make(map[string]int, len(newValidUsers))
+	for idx, user := range newValidUsers {
+		newUserByEmail[strings.ToLower(user.Email)] = idx
+	}
+
+	v.validUsers = newValidUsers
+	v.ids = newIds
+	v.shortlist = newShortlist
+	v.userByEmail = newUserByEmail
+}
+
+// Replace atomically swaps the validator's entire user set for users,
+// regenerating the rolling hash window from scratch under the write lock.
+// It is intended for hot-reloading large user sets from a UserSource without
+// restarting the inbound handler; unlike repeated Add/Remove calls, callers
+// observe either the old set or the new set, never a partial mix.
+func (v *TimedUserValidator) Replace(users []*protocol.User) error {
+	validUsers := make([]*protocol.User, 0, len(users))
+	userByEmail := make(map[string]int, len(users))
+	ids := make([]*idEntry, 0, len(users))
+
+	nowSec := time.Now().Unix()
+
+	for _, user := range users {
+		rawAccount, err := user.GetTypedAccount()
+		if err != nil {
+			return err
+		}
+		account := rawAccount.(*InternalAccount)
+
+		idx := len(validUsers)
+		validUsers = append(validUsers, user)
+		userByEmail[strings.ToLower(user.Email)] = idx
+
+		ids = append(ids, &idEntry{
+			id:      account.ID,
 			userIdx: idx,
 			lastSec: protocol.Timestamp(nowSec - cacheDurationSec),
+		})
+		for _, alterid := range account.AlterIDs {
+			ids = append(ids, &idEntry{
+				id:      alterid,
+				userIdx: idx,
+				lastSec: protocol.Timestamp(nowSec - cacheDurationSec),
+			})
 		}
+	}
+
+	v.Lock()
+	defer v.Unlock()
+
+	v.validUsers = validUsers
+	v.userByEmail = userByEmail
+	v.ids = ids
+	v.shortlist = make(map[[8]byte][]hashCandidate, len(ids))
+	v.usedHash = new(sync.Map)
+
+	for idx, entry := range v.ids {
 		v.generateNewHashes(protocol.Timestamp(nowSec+cacheDurationSec), idx, entry)
-		v.ids = append(v.ids, entry)
 	}
 
 	return nil
 }
 
+// Get validates userHash against the rolling hash window and returns the
+// matching user. The first 8 bytes of userHash select a shortlist of
+// candidate ring slots, each of which is verified against its full stored
+// hash before being accepted. Only an RLock is taken on the validator itself:
+// the shortlist and ring are only ever mutated under the write lock, and
+// replay bookkeeping lives in its own sync.Map, so concurrent Get calls -
+// the hot path for every VMess authentication - don't serialize on each
+// other. Each hash is only accepted once: a second Get call with the same
+// hash is treated as a replayed handshake and rejected, unless replay
+// detection was disabled via DisableReplayFilter.
 func (v *TimedUserValidator) Get(userHash []byte) (*protocol.User, protocol.Timestamp, bool) {
-	defer v.RUnlock()
 	v.RLock()
+	defer v.RUnlock()
 
 	var fixedSizeHash [16]byte
 	copy(fixedSizeHash[:], userHash)
-	pair, found := v.userHash[fixedSizeHash]
-	if found {
-		return v.validUsers[pair.index], protocol.Timestamp(pair.timeInc) + v.baseTime, true
+
+	for _, candidate := range v.shortlist[shortKeyOf(fixedSizeHash)] {
+		entry := v.ids[candidate.entryIdx]
+		slot := entry.ring[candidate.ringPos]
+		if !slot.valid || slot.full != fixedSizeHash {
+			continue
+		}
+
+		if !v.disableReplay {
+			if _, replayed := v.usedHash.LoadOrStore(fixedSizeHash, slot.timeInc); replayed {
+				return nil, 0, false
+			}
+		}
+		return v.validUsers[entry.userIdx], protocol.Timestamp(slot.timeInc) + v.baseTime, true
 	}
 	return nil, 0, false
 }
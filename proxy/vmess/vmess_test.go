@@ -0,0 +1,186 @@
+package vmess
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"hash"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"v2ray.com/core/common/protocol"
+	"v2ray.com/core/common/serial"
+)
+
+func testHasher(key []byte) hash.Hash {
+	return hmac.New(md5.New, key)
+}
+
+func newTestUser(email, id string) *protocol.User {
+	return &protocol.User{
+		Email: email,
+		Account: serial.ToTypedMessage(&Account{
+			Id: id,
+		}),
+	}
+}
+
+func newTestValidator(opts ...Option) (*TimedUserValidator, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	v := NewTimedUserValidator(ctx, testHasher, opts...).(*TimedUserValidator)
+	return v, cancel
+}
+
+// latestHash returns the most recently generated hash for entry, which Add
+// always populates a window of valid hashes around "now" for.
+func latestHash(entry *idEntry) []byte {
+	pos := (entry.ringHead - 1 + hashRingSize) % hashRingSize
+	full := entry.ring[pos].full
+	return full[:]
+}
+
+func TestGetRejectsReplayedHash(t *testing.T) {
+	v, cancel := newTestValidator()
+	defer cancel()
+
+	user := newTestUser("[email protected]", "b831381d-6324-4d53-ad4f-8cda48b30811")
+	if err := v.Add(user); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	hashBytes := latestHash(v.ids[0])
+
+	if _, _, ok := v.Get(hashBytes); !ok {
+		t.Fatalf("expected first Get to succeed")
+	}
+	if _, _, ok := v.Get(hashBytes); ok {
+		t.Fatalf("expected replayed hash to be rejected")
+	}
+}
+
+func TestDisableReplayFilterAllowsRepeat(t *testing.T) {
+	v, cancel := newTestValidator(DisableReplayFilter())
+	defer cancel()
+
+	user := newTestUser("[email protected]", "b831381d-6324-4d53-ad4f-8cda48b30812")
+	if err := v.Add(user); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	hashBytes := latestHash(v.ids[0])
+
+	if _, _, ok := v.Get(hashBytes); !ok {
+		t.Fatalf("expected first Get to succeed")
+	}
+	if _, _, ok := v.Get(hashBytes); !ok {
+		t.Fatalf("expected repeated Get to succeed when replay filter is disabled")
+	}
+}
+
+func TestUsedHashAgesOut(t *testing.T) {
+	v, cancel := newTestValidator()
+	defer cancel()
+
+	user := newTestUser("[email protected]", "b831381d-6324-4d53-ad4f-8cda48b30813")
+	if err := v.Add(user); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	hashBytes := latestHash(v.ids[0])
+	var fixedSizeHash [16]byte
+	copy(fixedSizeHash[:], hashBytes)
+
+	if _, _, ok := v.Get(hashBytes); !ok {
+		t.Fatalf("expected first Get to succeed")
+	}
+	if _, _, ok := v.Get(hashBytes); ok {
+		t.Fatalf("expected replayed hash to be rejected before aging out")
+	}
+
+	value, _ := v.usedHash.Load(fixedSizeHash)
+	timeInc := value.(uint32)
+	v.removeExpiredUsedHashes(timeInc + 1)
+
+	if _, _, ok := v.Get(hashBytes); !ok {
+		t.Fatalf("expected Get to succeed again once the usedHash entry aged out")
+	}
+}
+
+func TestConcurrentGetAcceptsHashExactlyOnce(t *testing.T) {
+	v, cancel := newTestValidator()
+	defer cancel()
+
+	user := newTestUser("[email protected]", "b831381d-6324-4d53-ad4f-8cda48b30814")
+	if err := v.Add(user); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	hashBytes := latestHash(v.ids[0])
+
+	const workers = 50
+	var successCount int32
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			if _, _, ok := v.Get(hashBytes); ok {
+				atomic.AddInt32(&successCount, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if successCount != 1 {
+		t.Fatalf("expected exactly 1 successful concurrent Get for a replayed hash, got %d", successCount)
+	}
+}
+
+func TestRemoveCompactsIdsAndValidUsers(t *testing.T) {
+	v, cancel := newTestValidator()
+	defer cancel()
+
+	userA := newTestUser("a@example.com", "b831381d-6324-4d53-ad4f-8cda48b30830")
+	userB := newTestUser("b@example.com", "b831381d-6324-4d53-ad4f-8cda48b30831")
+	userC := newTestUser("c@example.com", "b831381d-6324-4d53-ad4f-8cda48b30832")
+	for _, user := range []*protocol.User{userA, userB, userC} {
+		if err := v.Add(user); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+
+	hashA := append([]byte(nil), latestHash(v.ids[0])...)
+	hashB := append([]byte(nil), latestHash(v.ids[1])...)
+	hashC := append([]byte(nil), latestHash(v.ids[2])...)
+
+	if !v.Remove("b@example.com") {
+		t.Fatalf("expected Remove to report success for a known user")
+	}
+	if v.Remove("b@example.com") {
+		t.Fatalf("expected Remove to report false for an already-removed user")
+	}
+
+	if len(v.validUsers) != 2 {
+		t.Fatalf("expected compact to drop the removed user, got %d validUsers", len(v.validUsers))
+	}
+	if len(v.ids) != 2 {
+		t.Fatalf("expected compact to drop the removed idEntry, got %d ids", len(v.ids))
+	}
+	if _, found := v.userByEmail["b@example.com"]; found {
+		t.Fatalf("expected userByEmail to no longer contain the removed user")
+	}
+
+	if _, _, ok := v.Get(hashB); ok {
+		t.Fatalf("expected the removed user's hash to be rejected")
+	}
+
+	gotA, _, ok := v.Get(hashA)
+	if !ok || gotA != userA {
+		t.Fatalf("expected user A to still authenticate after compaction")
+	}
+	gotC, _, ok := v.Get(hashC)
+	if !ok || gotC != userC {
+		t.Fatalf("expected user C to still authenticate after compaction")
+	}
+}